@@ -19,6 +19,8 @@ package clique
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -60,6 +62,53 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*Snapshot, error) {
 	return api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
 }
 
+// GetSnapshotAtTime retrieves the state snapshot at the last canonical block
+// produced at or before the given unix timestamp. Timestamps past the current
+// head resolve to the head, whereas timestamps predating the genesis fail.
+func (api *API) GetSnapshotAtTime(timestamp uint64) (*Snapshot, error) {
+	// Find the first block past the timestamp, the one before is the match
+	var (
+		head    = api.chain.CurrentHeader().Number.Uint64()
+		missing = false
+	)
+	n := sort.Search(int(head)+1, func(i int) bool {
+		header := api.chain.GetHeaderByNumber(uint64(i))
+		if header == nil {
+			missing = true
+			return true
+		}
+		return header.Time > timestamp
+	})
+	if missing {
+		return nil, errUnknownBlock
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("timestamp %d predates the genesis", timestamp)
+	}
+	header := api.chain.GetHeaderByNumber(uint64(n - 1))
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+}
+
+// RebuildSnapshot discards the cached state snapshot at a given block and
+// regenerates it from the nearest ancestor snapshot.
+func (api *API) RebuildSnapshot(number *rpc.BlockNumber) (*Snapshot, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have an actually valid block and rebuild its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.clique.rebuildSnapshot(api.chain, header.Number.Uint64(), header.Hash())
+}
+
 // GetSigners retrieves the list of authorized signers at the specified block.
 func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	// Retrieve the requested block number (or current if none requested)
@@ -179,6 +228,314 @@ func (api *API) Status() (*status, error) {
 	}, nil
 }
 
+// CalcDifficulty returns the difficulty a signer would assign to a block at the
+// given height, derived from the snapshot of the block's parent. If no height
+// is requested, the next block on top of the current head is used. Signers not
+// authorized at that height are rejected, as they can't seal the block at all.
+func (api *API) CalcDifficulty(number *rpc.BlockNumber, signer common.Address) (*hexutil.Big, error) {
+	// Retrieve the parent of the requested block number (or current head if none requested)
+	var parent *types.Header
+	switch {
+	case number == nil || *number == rpc.PendingBlockNumber:
+		parent = api.chain.CurrentHeader()
+	case *number == rpc.LatestBlockNumber:
+		if head := api.chain.CurrentHeader(); head.Number.Sign() > 0 {
+			parent = api.chain.GetHeader(head.ParentHash, head.Number.Uint64()-1)
+		}
+	case *number > 0:
+		parent = api.chain.GetHeaderByNumber(uint64(number.Int64()) - 1)
+	}
+	// Ensure we have an actually valid parent and calculate on top of its snapshot
+	if parent == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.clique.snapshot(api.chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := snap.Signers[signer]; !ok {
+		return nil, errUnauthorizedSigner
+	}
+	return (*hexutil.Big)(calcDifficulty(snap, signer)), nil
+}
+
+// DryRunHeader checks a candidate block or header, given as an RLP encoded blob,
+// against the consensus rules on top of its parent, returning every rule it
+// violates. The candidate is not imported, nor is its snapshot cached or stored.
+func (api *API) DryRunHeader(blob hexutil.Bytes) ([]string, error) {
+	header := new(types.Header)
+	if block := new(types.Block); rlp.DecodeBytes(blob, block) == nil {
+		header = block.Header()
+	} else if err := rlp.DecodeBytes(blob, header); err != nil {
+		return nil, err
+	}
+	errs, err := api.clique.dryRunHeader(api.chain, header)
+	if err != nil {
+		return nil, err
+	}
+	reasons := make([]string, len(errs))
+	for i, err := range errs {
+		reasons[i] = err.Error()
+	}
+	return reasons, nil
+}
+
+type snapshotStats struct {
+	Number  uint64      `json:"number"`
+	Hash    common.Hash `json:"hash"`
+	Signers int         `json:"signers"`
+	Recents int         `json:"recents"`
+	Votes   int         `json:"votes"`
+	Tally   int         `json:"tally"`
+	Size    int         `json:"size"`
+	Cached  int         `json:"cached"`
+}
+
+// SnapshotStats returns the size report of the snapshot at a given block,
+// - the number of entries in each of the snapshot's collections,
+// - the byte size of the snapshot as it is stored in the database,
+// - the number of snapshots currently held in the in-memory cache
+func (api *API) SnapshotStats(number *rpc.BlockNumber) (*snapshotStats, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have an actually valid block and measure its snapshot
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStats{
+		Number:  snap.Number,
+		Hash:    snap.Hash,
+		Signers: len(snap.Signers),
+		Recents: len(snap.Recents),
+		Votes:   len(snap.Votes),
+		Tally:   len(snap.Tally),
+		Size:    len(blob),
+		Cached:  api.clique.recents.Len(),
+	}, nil
+}
+
+// GovernanceChangeBlocks returns the numbers of the blocks within the given
+// inclusive range where the set of authorized signers changed compared to the
+// parent block, derived by replaying the snapshots across the range.
+func (api *API) GovernanceChangeBlocks(from, to rpc.BlockNumber) ([]uint64, error) {
+	start, end, err := api.resolveRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]uint64, 0)
+	err = api.replay(start, end, func(header *types.Header, parent, snap *Snapshot) {
+		if parent != nil && !maps.Equal(parent.Signers, snap.Signers) {
+			changes = append(changes, header.Number.Uint64())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+type participation struct {
+	Blocks int  `json:"blocks"` // Number of blocks sealed within the range
+	Voted  bool `json:"voted"`  // Whether any vote was cast within the range
+}
+
+// SignerParticipation returns the participation of every signer authorized at
+// some point within the given inclusive range, with the number of blocks they
+// sealed and whether they cast any vote, derived by replaying the range.
+func (api *API) SignerParticipation(from, to rpc.BlockNumber) (map[common.Address]*participation, error) {
+	start, end, err := api.resolveRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := make(map[common.Address]*participation)
+	err = api.replay(start, end, func(header *types.Header, parent, snap *Snapshot) {
+		// The genesis is not sealed, only count the blocks signed on top of it
+		if parent == nil {
+			return
+		}
+		for signer := range parent.Signers {
+			if _, ok := report[signer]; !ok {
+				report[signer] = new(participation)
+			}
+		}
+		sealer := snap.Recents[header.Number.Uint64()]
+		report[sealer].Blocks++
+		if header.Coinbase != (common.Address{}) {
+			report[sealer].Voted = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+type servedRange struct {
+	Address common.Address `json:"address"` // Signer serving throughout the range
+	From    uint64         `json:"from"`    // First block the address was authorized at
+	To      uint64         `json:"to"`      // Last block the address was authorized at
+}
+
+// SignerHistory returns every address that has been an authorized signer within
+// the given inclusive range, along with the block ranges they served, clipped to
+// the requested one. An address removed and re-added has multiple ranges served.
+func (api *API) SignerHistory(from, to rpc.BlockNumber) ([]*servedRange, error) {
+	start, end, err := api.resolveRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		history = make([]*servedRange, 0)
+		serving = make(map[common.Address]*servedRange)
+	)
+	err = api.replay(start, end, func(header *types.Header, parent, snap *Snapshot) {
+		number := header.Number.Uint64()
+		for _, signer := range snap.signers() {
+			if served, ok := serving[signer]; ok && served.To+1 == number {
+				served.To = number
+				continue
+			}
+			served := &servedRange{Address: signer, From: number, To: number}
+			history = append(history, served)
+			serving[signer] = served
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+type membershipEvent struct {
+	Block      uint64 `json:"block"`      // Block number the membership changed at
+	Authorized bool   `json:"authorized"` // Whether the address was authorized or deauthorized
+}
+
+type timeline struct {
+	Signer bool              `json:"signer"` // Whether the address was authorized before the range
+	Events []membershipEvent `json:"events"` // Membership changes within the range
+}
+
+// SignerTimeline returns the ordered membership changes of a single address
+// within the given inclusive range, along with whether it was an authorized
+// signer before the range started. The initial signers are reported as being
+// authorized in the genesis block.
+func (api *API) SignerTimeline(address common.Address, from, to rpc.BlockNumber) (*timeline, error) {
+	start, end, err := api.resolveRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &timeline{Events: make([]membershipEvent, 0)}
+	err = api.replay(start, end, func(header *types.Header, parent, snap *Snapshot) {
+		var before bool
+		if parent != nil {
+			_, before = parent.Signers[address]
+		}
+		_, after := snap.Signers[address]
+
+		if header.Number.Uint64() == start {
+			report.Signer = before
+		}
+		if before != after {
+			report.Events = append(report.Events, membershipEvent{Block: header.Number.Uint64(), Authorized: after})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// resolveRange resolves an inclusive block range against the current head. Only
+// explicit block numbers and the latest tag are accepted, anything else (e.g.
+// pending or finalized) is rejected. Ranges longer than maxReplayBlocks are also
+// rejected to keep the replay cost of a single request bounded.
+func (api *API) resolveRange(from, to rpc.BlockNumber) (uint64, uint64, error) {
+	head := api.chain.CurrentHeader().Number.Uint64()
+
+	resolve := func(number rpc.BlockNumber) (uint64, error) {
+		switch {
+		case number == rpc.LatestBlockNumber:
+			return head, nil
+		case number < 0:
+			return 0, fmt.Errorf("unsupported block number %v", number)
+		}
+		return uint64(number.Int64()), nil
+	}
+	start, err := resolve(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := resolve(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid block range %d-%d", start, end)
+	}
+	if end-start >= maxReplayBlocks {
+		return 0, 0, fmt.Errorf("block range too long: have %d, max %d", end-start+1, maxReplayBlocks)
+	}
+	if end > head {
+		return 0, 0, errUnknownBlock
+	}
+	return start, end, nil
+}
+
+// replay walks the canonical blocks of an inclusive range, calling fn with each
+// header along with the snapshots before and after it (the parent is nil for the
+// genesis). Only the snapshot preceding the range is retrieved via the engine,
+// the rest are derived by applying the headers one by one, so the replay neither
+// floods the snapshot cache nor stores checkpoints.
+func (api *API) replay(start, end uint64, fn func(header *types.Header, parent, snap *Snapshot)) error {
+	var parent *Snapshot
+	if start > 0 {
+		header := api.chain.GetHeaderByNumber(start - 1)
+		if header == nil {
+			return fmt.Errorf("missing block %d", start-1)
+		}
+		snap, err := api.clique.snapshot(api.chain, start-1, header.Hash(), nil)
+		if err != nil {
+			return err
+		}
+		parent = snap
+	}
+	for n := start; n <= end; n++ {
+		header := api.chain.GetHeaderByNumber(n)
+		if header == nil {
+			return fmt.Errorf("missing block %d", n)
+		}
+		var (
+			snap *Snapshot
+			err  error
+		)
+		if parent == nil {
+			snap, err = api.clique.snapshot(api.chain, n, header.Hash(), nil)
+		} else {
+			snap, err = parent.apply([]*types.Header{header})
+		}
+		if err != nil {
+			return err
+		}
+		fn(header, parent, snap)
+		parent = snap
+	}
+	return nil
+}
+
 type blockNumberOrHashOrRLP struct {
 	*rpc.BlockNumberOrHash
 	RLP hexutil.Bytes `json:"rlp,omitempty"`
@@ -0,0 +1,780 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTesterAPI creates a Clique chain with the given epoch length and initial
+// signers, imports a block for each of the votes and returns the RPC API on top
+// of it.
+func newTesterAPI(t *testing.T, accounts *testerAccountPool, epoch uint64, signers []string, votes []testerVote) *API {
+	t.Helper()
+
+	// Create the genesis block with the initial set of signers
+	auths := make([]common.Address, len(signers))
+	for i, signer := range signers {
+		auths[i] = accounts.address(signer)
+	}
+	slices.SortFunc(auths, common.Address.Cmp)
+
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength*len(auths)+extraSeal),
+		BaseFee:   big.NewInt(params.InitialBaseFee),
+	}
+	for i, auth := range auths {
+		copy(genesis.ExtraData[extraVanity+i*common.AddressLength:], auth[:])
+	}
+	config := *params.TestChainConfig
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: epoch}
+	genesis.Config = &config
+
+	engine := New(config.Clique, rawdb.NewMemoryDatabase())
+	engine.fakeDiff = true
+
+	// Assemble and seal a chain of blocks from the cast votes
+	_, blocks, _ := core.GenerateChainWithGenesis(genesis, engine, len(votes), func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(accounts.address(votes[i].voted))
+		if votes[i].auth {
+			var nonce types.BlockNonce
+			copy(nonce[:], nonceAuthVote)
+			gen.SetNonce(nonce)
+		}
+	})
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		if auths := votes[i].checkpoint; auths != nil {
+			header.Extra = make([]byte, extraVanity+len(auths)*common.AddressLength+extraSeal)
+			accounts.checkpoint(header, auths)
+		}
+		header.Difficulty = diffInTurn // Ignored, we just need a valid number
+
+		accounts.sign(header, votes[i].signer)
+		blocks[i] = block.WithSeal(header)
+	}
+	chain, err := core.NewBlockChain(rawdb.NewMemoryDatabase(), nil, genesis, nil, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import test chain: %v", err)
+	}
+	return &API{chain: chain, clique: engine}
+}
+
+// Tests that the snapshot size report matches the contents of the snapshot.
+func TestSnapshotStats(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B", "C"}, []testerVote{
+		{signer: "A", voted: "D", auth: true},
+		{signer: "B", voted: "E", auth: true},
+		{signer: "C", voted: "A"},
+	})
+	number := rpc.BlockNumber(3)
+	stats, err := api.SnapshotStats(&number)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot stats: %v", err)
+	}
+	snap, err := api.GetSnapshot(&number)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if stats.Number != snap.Number || stats.Hash != snap.Hash {
+		t.Errorf("snapshot mismatch: have %d/%x, want %d/%x", stats.Number, stats.Hash, snap.Number, snap.Hash)
+	}
+	if stats.Signers != len(snap.Signers) || stats.Signers != 3 {
+		t.Errorf("signers mismatch: have %d, want %d", stats.Signers, len(snap.Signers))
+	}
+	if stats.Recents != len(snap.Recents) || stats.Recents != 2 {
+		t.Errorf("recents mismatch: have %d, want %d", stats.Recents, len(snap.Recents))
+	}
+	if stats.Votes != len(snap.Votes) || stats.Votes != 3 {
+		t.Errorf("votes mismatch: have %d, want %d", stats.Votes, len(snap.Votes))
+	}
+	if stats.Tally != len(snap.Tally) || stats.Tally != 3 {
+		t.Errorf("tally mismatch: have %d, want %d", stats.Tally, len(snap.Tally))
+	}
+	blob, _ := json.Marshal(snap)
+	if stats.Size != len(blob) {
+		t.Errorf("size mismatch: have %d, want %d", stats.Size, len(blob))
+	}
+	if stats.Cached != api.clique.recents.Len() || stats.Cached == 0 {
+		t.Errorf("cached mismatch: have %d, want %d", stats.Cached, api.clique.recents.Len())
+	}
+}
+
+// Tests that timestamps are mapped to the snapshot of the last block produced at
+// or before them.
+func TestGetSnapshotAtTime(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+		{signer: "C"},
+	})
+	var (
+		first  = api.chain.GetHeaderByNumber(1)
+		second = api.chain.GetHeaderByNumber(2)
+	)
+	tests := []struct {
+		timestamp uint64
+		number    uint64
+		signers   []string
+	}{
+		{0, 0, []string{"A", "B"}},
+		{first.Time, 1, []string{"A", "B"}},
+		{second.Time - 1, 1, []string{"A", "B"}},
+		{second.Time, 2, []string{"A", "B", "C"}},
+		{math.MaxUint64, 3, []string{"A", "B", "C"}},
+	}
+	for i, tt := range tests {
+		snap, err := api.GetSnapshotAtTime(tt.timestamp)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve snapshot: %v", i, err)
+		}
+		if snap.Number != tt.number {
+			t.Errorf("test %d: block mismatch: have %d, want %d", i, snap.Number, tt.number)
+		}
+		want := make([]common.Address, len(tt.signers))
+		for j, signer := range tt.signers {
+			want[j] = accounts.address(signer)
+		}
+		slices.SortFunc(want, common.Address.Cmp)
+		if !slices.Equal(snap.signers(), want) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, snap.signers(), want)
+		}
+	}
+}
+
+// Tests that the blocks changing the set of authorized signers are reported for
+// various ranges.
+func TestGovernanceChangeBlocks(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+		{signer: "C"},
+		{signer: "A", voted: "D", auth: true},
+		{signer: "B", voted: "D", auth: true}, // D authorized
+		{signer: "C"},
+	})
+	tests := []struct {
+		from, to rpc.BlockNumber
+		changes  []uint64
+	}{
+		{0, 6, []uint64{2, 5}},
+		{1, 6, []uint64{2, 5}},
+		{3, rpc.LatestBlockNumber, []uint64{5}},
+		{2, 2, []uint64{2}},
+		{0, 1, []uint64{}},
+		{rpc.LatestBlockNumber, rpc.LatestBlockNumber, []uint64{}},
+	}
+	for i, tt := range tests {
+		changes, err := api.GovernanceChangeBlocks(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve changes: %v", i, err)
+		}
+		if !slices.Equal(changes, tt.changes) {
+			t.Errorf("test %d: changes mismatch: have %v, want %v", i, changes, tt.changes)
+		}
+	}
+	// Ensure invalid ranges are rejected
+	if _, err := api.GovernanceChangeBlocks(5, 2); err == nil {
+		t.Errorf("inverted range accepted")
+	}
+	if _, err := api.GovernanceChangeBlocks(1, 7); err != errUnknownBlock {
+		t.Errorf("future range error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+	for _, tag := range []rpc.BlockNumber{rpc.PendingBlockNumber, rpc.SafeBlockNumber, rpc.FinalizedBlockNumber} {
+		if _, err := api.GovernanceChangeBlocks(tag, 6); err == nil {
+			t.Errorf("%v range start accepted", tag)
+		}
+		if _, err := api.GovernanceChangeBlocks(0, tag); err == nil {
+			t.Errorf("%v range end accepted", tag)
+		}
+	}
+	if _, err := api.GovernanceChangeBlocks(0, maxReplayBlocks-1); err != errUnknownBlock {
+		t.Errorf("maximal range error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+	if _, err := api.GovernanceChangeBlocks(0, maxReplayBlocks); err == nil || err == errUnknownBlock {
+		t.Errorf("overlong range error mismatch: have %v", err)
+	}
+	// Ensure the replay only caches the snapshot it starts from
+	api.clique.recents.Purge()
+	if _, err := api.GovernanceChangeBlocks(0, 6); err != nil {
+		t.Fatalf("failed to retrieve changes: %v", err)
+	}
+	if n := api.clique.recents.Len(); n != 1 {
+		t.Errorf("cached snapshot count mismatch: have %d, want 1", n)
+	}
+}
+
+// Tests that the ranges served by the signers are reported across removals and
+// re-additions.
+func TestSignerHistory(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+		{signer: "C"},
+		{signer: "A", voted: "C"},
+		{signer: "B", voted: "C"}, // C deauthorized
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+	})
+	type served struct {
+		signer   string
+		from, to uint64
+	}
+	tests := []struct {
+		from, to rpc.BlockNumber
+		history  []served
+	}{
+		{0, rpc.LatestBlockNumber, []served{{"A", 0, 7}, {"B", 0, 7}, {"C", 2, 4}, {"C", 7, 7}}},
+		{3, 6, []served{{"A", 3, 6}, {"B", 3, 6}, {"C", 3, 4}}},
+		{5, 6, []served{{"A", 5, 6}, {"B", 5, 6}}},
+	}
+	for i, tt := range tests {
+		history, err := api.SignerHistory(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve history: %v", i, err)
+		}
+		// The signers are ordered by address within each block, not by name
+		want := make([]*servedRange, len(tt.history))
+		for j, served := range tt.history {
+			want[j] = &servedRange{Address: accounts.address(served.signer), From: served.from, To: served.to}
+		}
+		slices.SortStableFunc(want, func(a, b *servedRange) int {
+			if a.From != b.From {
+				return int(a.From) - int(b.From)
+			}
+			return a.Address.Cmp(b.Address)
+		})
+		if !slices.EqualFunc(history, want, func(a, b *servedRange) bool { return *a == *b }) {
+			t.Errorf("test %d: history mismatch: have %v, want %v", i, history, want)
+		}
+	}
+}
+
+// Tests that the membership timeline of an address is reported across removals
+// and re-additions.
+func TestSignerTimeline(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+		{signer: "C"},
+		{signer: "A", voted: "C"},
+		{signer: "B", voted: "C"}, // C deauthorized
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+	})
+	tests := []struct {
+		signer   string
+		from, to rpc.BlockNumber
+		timeline timeline
+	}{
+		{"C", 0, rpc.LatestBlockNumber, timeline{Events: []membershipEvent{{2, true}, {5, false}, {7, true}}}},
+		{"C", 3, 6, timeline{Signer: true, Events: []membershipEvent{{5, false}}}},
+		{"C", 2, 2, timeline{Events: []membershipEvent{{2, true}}}},
+		{"A", 0, rpc.LatestBlockNumber, timeline{Events: []membershipEvent{{0, true}}}},
+		{"A", 1, rpc.LatestBlockNumber, timeline{Signer: true, Events: []membershipEvent{}}},
+		{"D", 0, rpc.LatestBlockNumber, timeline{Events: []membershipEvent{}}},
+	}
+	for i, tt := range tests {
+		have, err := api.SignerTimeline(accounts.address(tt.signer), tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve timeline: %v", i, err)
+		}
+		if have.Signer != tt.timeline.Signer {
+			t.Errorf("test %d: initial membership mismatch: have %v, want %v", i, have.Signer, tt.timeline.Signer)
+		}
+		if !slices.Equal(have.Events, tt.timeline.Events) {
+			t.Errorf("test %d: events mismatch: have %v, want %v", i, have.Events, tt.timeline.Events)
+		}
+	}
+}
+
+// Tests that the participation of the signers is reported over custom ranges.
+func TestSignerParticipation(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B"},
+		{signer: "A"},
+		{signer: "B", voted: "C", auth: true}, // C authorized
+		{signer: "C"},
+		{signer: "A"},
+	})
+	tests := []struct {
+		from, to rpc.BlockNumber
+		report   map[string]participation
+	}{
+		{0, rpc.LatestBlockNumber, map[string]participation{
+			"A": {Blocks: 3, Voted: true},
+			"B": {Blocks: 2, Voted: true},
+			"C": {Blocks: 1},
+		}},
+		{1, 2, map[string]participation{
+			"A": {Blocks: 1, Voted: true},
+			"B": {Blocks: 1},
+		}},
+		{5, 6, map[string]participation{
+			"A": {Blocks: 1},
+			"B": {},
+			"C": {Blocks: 1},
+		}},
+		{0, 0, map[string]participation{}},
+	}
+	for i, tt := range tests {
+		report, err := api.SignerParticipation(tt.from, tt.to)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve participation: %v", i, err)
+		}
+		if len(report) != len(tt.report) {
+			t.Errorf("test %d: signer count mismatch: have %d, want %d", i, len(report), len(tt.report))
+		}
+		for name, want := range tt.report {
+			if have := report[accounts.address(name)]; have == nil || *have != want {
+				t.Errorf("test %d: signer %s participation mismatch: have %v, want %v", i, name, have, want)
+			}
+		}
+	}
+	if _, err := api.SignerParticipation(rpc.PendingBlockNumber, rpc.LatestBlockNumber); err == nil {
+		t.Errorf("pending range start accepted")
+	}
+}
+
+// Tests that a corrupted snapshot, cached either in memory or on disk, can be
+// rebuilt from a trusted base, even if its cached ancestors are corrupt too.
+func TestRebuildSnapshot(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B"}, []testerVote{
+		{signer: "A", voted: "C", auth: true},
+		{signer: "B"},
+		{signer: "A"},
+		{signer: "B", voted: "D", auth: true},
+	})
+	// Corrupt the in-memory snapshot of a non-checkpoint block
+	number := rpc.BlockNumber(2)
+	snap, err := api.GetSnapshot(&number)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	want := snap.copy()
+
+	snap.Signers[accounts.address("D")] = struct{}{}
+	snap.Tally = make(map[common.Address]Tally)
+
+	rebuilt, err := api.RebuildSnapshot(&number)
+	if err != nil {
+		t.Fatalf("failed to rebuild snapshot: %v", err)
+	}
+	if !slices.Equal(rebuilt.signers(), want.signers()) {
+		t.Errorf("signers mismatch: have %x, want %x", rebuilt.signers(), want.signers())
+	}
+	if len(rebuilt.Tally) != 1 || rebuilt.Tally[accounts.address("C")] != want.Tally[accounts.address("C")] {
+		t.Errorf("tally mismatch: have %v, want %v", rebuilt.Tally, want.Tally)
+	}
+	if cached, _ := api.clique.recents.Get(rebuilt.Hash); cached != rebuilt {
+		t.Errorf("rebuilt snapshot not cached")
+	}
+	// Corrupt both the in-memory snapshot of a block and that of its parent
+	number = rpc.BlockNumber(4)
+	if snap, err = api.GetSnapshot(&number); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	want = snap.copy()
+
+	parent, ok := api.clique.recents.Get(api.chain.GetHeaderByNumber(3).Hash())
+	if !ok {
+		t.Fatalf("parent snapshot not cached")
+	}
+	parent.Tally[accounts.address("E")] = Tally{Authorize: true, Votes: 1}
+	snap.Tally = make(map[common.Address]Tally)
+
+	if rebuilt, err = api.RebuildSnapshot(&number); err != nil {
+		t.Fatalf("failed to rebuild snapshot: %v", err)
+	}
+	if len(rebuilt.Tally) != len(want.Tally) || rebuilt.Tally[accounts.address("D")] != want.Tally[accounts.address("D")] {
+		t.Errorf("tally mismatch: have %v, want %v", rebuilt.Tally, want.Tally)
+	}
+	if cached, ok := api.clique.recents.Get(parent.Hash); ok && cached == parent {
+		t.Errorf("corrupt parent snapshot still cached")
+	}
+	number = rpc.BlockNumber(3)
+	if snap, err = api.GetSnapshot(&number); err != nil {
+		t.Fatalf("failed to retrieve parent snapshot: %v", err)
+	}
+	if _, ok := snap.Tally[accounts.address("E")]; ok {
+		t.Errorf("parent snapshot not regenerated: %v", snap.Tally)
+	}
+	// Corrupt the on-disk checkpoint snapshot of the genesis block
+	number = rpc.BlockNumber(0)
+	if snap, err = api.GetSnapshot(&number); err != nil {
+		t.Fatalf("failed to retrieve genesis snapshot: %v", err)
+	}
+	want = snap.copy()
+
+	bad := snap.copy()
+	bad.Signers = map[common.Address]struct{}{accounts.address("D"): {}}
+	if err := bad.store(api.clique.db); err != nil {
+		t.Fatalf("failed to store corrupt snapshot: %v", err)
+	}
+	api.clique.recents.Remove(snap.Hash)
+
+	if rebuilt, err = api.RebuildSnapshot(&number); err != nil {
+		t.Fatalf("failed to rebuild genesis snapshot: %v", err)
+	}
+	if !slices.Equal(rebuilt.signers(), want.signers()) {
+		t.Errorf("genesis signers mismatch: have %x, want %x", rebuilt.signers(), want.signers())
+	}
+	stored, err := loadSnapshot(api.clique.config, api.clique.signatures, api.clique.db, rebuilt.Hash)
+	if err != nil {
+		t.Fatalf("failed to load rebuilt genesis snapshot: %v", err)
+	}
+	if !slices.Equal(stored.signers(), want.signers()) {
+		t.Errorf("stored genesis signers mismatch: have %x, want %x", stored.signers(), want.signers())
+	}
+}
+
+// Tests that corrupt on-disk checkpoints are skipped when picking the base of a
+// rebuild, falling back to an older trusted one.
+func TestRebuildSnapshotCorruptBase(t *testing.T) {
+	// Create a chain with an on-disk checkpoint on an epoch block
+	accounts := newTesterAccountPool()
+
+	votes := make([]testerVote, checkpointInterval+2)
+	for i := range votes {
+		votes[i] = testerVote{signer: []string{"A", "B"}[i%2]}
+	}
+	votes[checkpointInterval-1].checkpoint = []string{"A", "B"}
+	api := newTesterAPI(t, accounts, checkpointInterval, []string{"A", "B"}, votes)
+
+	checkpoint := api.chain.GetHeaderByNumber(checkpointInterval)
+	want, err := loadSnapshot(api.clique.config, api.clique.signatures, api.clique.db, checkpoint.Hash())
+	if err != nil {
+		t.Fatalf("failed to load checkpoint snapshot: %v", err)
+	}
+	tests := []func(snap *Snapshot){
+		// Tally entry without any votes behind it
+		func(snap *Snapshot) { snap.Tally[accounts.address("C")] = Tally{Authorize: true, Votes: 1} },
+		// Signers disagreeing with the epoch header
+		func(snap *Snapshot) { snap.Signers[accounts.address("C")] = struct{}{} },
+	}
+	for i, corrupt := range tests {
+		bad := want.copy()
+		corrupt(bad)
+		if err := bad.store(api.clique.db); err != nil {
+			t.Fatalf("test %d: failed to store corrupt checkpoint: %v", i, err)
+		}
+		number := rpc.BlockNumber(checkpointInterval + 2)
+		rebuilt, err := api.RebuildSnapshot(&number)
+		if err != nil {
+			t.Fatalf("test %d: failed to rebuild snapshot: %v", i, err)
+		}
+		if !slices.Equal(rebuilt.signers(), want.signers()) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, rebuilt.signers(), want.signers())
+		}
+		if len(rebuilt.Tally) != 0 {
+			t.Errorf("test %d: tally mismatch: have %v, want none", i, rebuilt.Tally)
+		}
+	}
+}
+
+// Tests that a rebuilt snapshot failing verification is neither cached in memory
+// nor stored to disk.
+func TestRebuildSnapshotFailure(t *testing.T) {
+	// Create a chain with an on-disk checkpoint right below an epoch block
+	accounts := newTesterAccountPool()
+
+	votes := make([]testerVote, checkpointInterval+2)
+	for i := range votes {
+		votes[i] = testerVote{signer: []string{"A", "B"}[i%2]}
+	}
+	votes[checkpointInterval+1].checkpoint = []string{"A", "B"}
+	api := newTesterAPI(t, accounts, checkpointInterval+2, []string{"A", "B"}, votes)
+
+	// Corrupt the signers of the on-disk checkpoint, which the checkpoint itself
+	// can't detect, but the epoch block on top of it can
+	checkpoint := api.chain.GetHeaderByNumber(checkpointInterval)
+	base, err := loadSnapshot(api.clique.config, api.clique.signatures, api.clique.db, checkpoint.Hash())
+	if err != nil {
+		t.Fatalf("failed to load checkpoint snapshot: %v", err)
+	}
+	base.Signers[accounts.address("C")] = struct{}{}
+	if err := base.store(api.clique.db); err != nil {
+		t.Fatalf("failed to store corrupt checkpoint: %v", err)
+	}
+	// Rebuild the epoch snapshot on top of it and ensure the result is discarded
+	number := rpc.BlockNumber(checkpointInterval + 2)
+	if _, err := api.GetSnapshot(&number); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if _, err := api.RebuildSnapshot(&number); err != errMismatchingCheckpointSigners {
+		t.Fatalf("corrupt rebuild error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	hash := api.chain.GetHeaderByNumber(uint64(number)).Hash()
+	if api.clique.recents.Contains(hash) {
+		t.Errorf("failed rebuild left snapshot in memory")
+	}
+	if ok, _ := api.clique.db.Has(append(rawdb.CliqueSnapshotPrefix, hash[:]...)); ok {
+		t.Errorf("failed rebuild stored snapshot to disk")
+	}
+	// Rebuilding the checkpoint itself falls back to the genesis and fixes it
+	cp := rpc.BlockNumber(checkpointInterval)
+	rebuilt, err := api.RebuildSnapshot(&cp)
+	if err != nil {
+		t.Fatalf("failed to rebuild checkpoint snapshot: %v", err)
+	}
+	if len(rebuilt.Signers) != 2 {
+		t.Errorf("rebuilt checkpoint signers mismatch: have %x, want 2", rebuilt.signers())
+	}
+	stored, err := loadSnapshot(api.clique.config, api.clique.signatures, api.clique.db, checkpoint.Hash())
+	if err != nil {
+		t.Fatalf("failed to load rebuilt checkpoint snapshot: %v", err)
+	}
+	if len(stored.Signers) != 2 {
+		t.Errorf("stored checkpoint signers mismatch: have %x, want 2", stored.signers())
+	}
+	if _, err := api.RebuildSnapshot(&number); err != nil {
+		t.Errorf("failed to rebuild epoch snapshot: %v", err)
+	}
+}
+
+// Tests that dry-running a candidate header reports every rule it violates,
+// without caching it.
+func TestDryRunHeader(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B", "C"}, []testerVote{
+		{signer: "A"},
+		{signer: "B"},
+		{signer: "C"},
+		{signer: "A"},
+	})
+	head := api.chain.CurrentHeader()
+
+	// Check the difficulties too, which the tester chain had to fake
+	api.clique.fakeDiff = false
+
+	snap, err := api.clique.snapshot(api.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve head snapshot: %v", err)
+	}
+	// candidate assembles a valid header on top of the head, breaks it as requested,
+	// then signs and encodes it
+	candidate := func(signer string, mutate func(header *types.Header)) ([]byte, common.Hash) {
+		header := &types.Header{
+			ParentHash: head.Hash(),
+			UncleHash:  types.EmptyUncleHash,
+			Number:     new(big.Int).Add(head.Number, common.Big1),
+			GasLimit:   head.GasLimit,
+			Time:       head.Time + 1,
+			Extra:      make([]byte, extraVanity+extraSeal),
+			Difficulty: calcDifficulty(snap, accounts.address(signer)),
+		}
+		if mutate != nil {
+			mutate(header)
+		}
+		accounts.sign(header, signer)
+
+		blob, err := rlp.EncodeToBytes(header)
+		if err != nil {
+			t.Fatalf("failed to encode header: %v", err)
+		}
+		return blob, header.Hash()
+	}
+	tests := []struct {
+		signer  string
+		mutate  func(header *types.Header)
+		reasons []error
+	}{
+		// Valid header from a signer allowed to seal
+		{signer: "B"},
+		// Unauthorized signer
+		{signer: "D", reasons: []error{errUnauthorizedSigner}},
+		// Header from the future
+		{
+			signer:  "B",
+			mutate:  func(header *types.Header) { header.Time = uint64(time.Now().Add(time.Hour).Unix()) },
+			reasons: []error{consensus.ErrFutureBlock},
+		},
+		// Fork protection and uncle fields set
+		{
+			signer: "B",
+			mutate: func(header *types.Header) {
+				header.MixDigest = common.Hash{0x01}
+				header.UncleHash = common.Hash{}
+			},
+			reasons: []error{errInvalidMixDigest, errInvalidUncleHash},
+		},
+		// Meaningless and wrong turn-ness difficulties
+		{
+			signer:  "B",
+			mutate:  func(header *types.Header) { header.Difficulty = big.NewInt(3) },
+			reasons: []error{errInvalidDifficulty},
+		},
+		{
+			signer: "B",
+			mutate: func(header *types.Header) {
+				if header.Difficulty.Cmp(diffInTurn) == 0 {
+					header.Difficulty = diffNoTurn
+				} else {
+					header.Difficulty = diffInTurn
+				}
+			},
+			reasons: []error{errWrongDifficulty},
+		},
+		// Multiple violations at once
+		{
+			signer: "A",
+			mutate: func(header *types.Header) {
+				header.Time = head.Time
+				header.Nonce = types.EncodeNonce(1)
+				header.Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+			},
+			reasons: []error{errInvalidVote, errExtraSigners, errInvalidTimestamp, errRecentlySigned},
+		},
+	}
+	for i, tt := range tests {
+		blob, hash := candidate(tt.signer, tt.mutate)
+		reasons, err := api.DryRunHeader(blob)
+		if err != nil {
+			t.Fatalf("test %d: failed to dry-run header: %v", i, err)
+		}
+		want := make([]string, len(tt.reasons))
+		for j, reason := range tt.reasons {
+			want[j] = reason.Error()
+		}
+		if !slices.Equal(reasons, want) {
+			t.Errorf("test %d: reasons mismatch: have %q, want %q", i, reasons, want)
+		}
+		if api.clique.recents.Contains(hash) {
+			t.Errorf("test %d: dry-run snapshot cached", i)
+		}
+	}
+	// Corrupt the parent snapshot and ensure the tally breach is reported
+	parent, ok := api.clique.recents.Get(head.Hash())
+	if !ok {
+		t.Fatalf("parent snapshot not cached")
+	}
+	parent.Tally[accounts.address("E")] = Tally{Authorize: true, Votes: 1}
+
+	blob, _ := candidate("B", nil)
+	reasons, err := api.DryRunHeader(blob)
+	if err != nil {
+		t.Fatalf("failed to dry-run header: %v", err)
+	}
+	if len(reasons) != 1 {
+		t.Errorf("tally breach not reported: %q", reasons)
+	}
+	// Ensure headers without a known parent can't be checked
+	header := &types.Header{Number: big.NewInt(10), Extra: make([]byte, extraVanity+extraSeal)}
+	blob, _ = rlp.EncodeToBytes(header)
+	if _, err := api.DryRunHeader(blob); err != consensus.ErrUnknownAncestor {
+		t.Errorf("orphan error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
+
+// Tests that the difficulty reported over the API matches the one the engine
+// assigns for each signer at various heights.
+func TestCalcDifficulty(t *testing.T) {
+	accounts := newTesterAccountPool()
+	api := newTesterAPI(t, accounts, epochLength, []string{"A", "B", "C"}, []testerVote{
+		{signer: "A"},
+		{signer: "B"},
+		{signer: "C"},
+		{signer: "A"},
+	})
+	signers := []string{"A", "B", "C"}
+	for n := uint64(1); n <= 5; n++ {
+		parent := api.chain.GetHeaderByNumber(n - 1)
+
+		var inturn int
+		for _, signer := range signers {
+			number := rpc.BlockNumber(n)
+			have, err := api.CalcDifficulty(&number, accounts.address(signer))
+			if err != nil {
+				t.Fatalf("block %d, signer %s: failed to calculate difficulty: %v", n, signer, err)
+			}
+			api.clique.Authorize(accounts.address(signer))
+			if want := api.clique.CalcDifficulty(api.chain, 0, parent); have.ToInt().Cmp(want) != 0 {
+				t.Errorf("block %d, signer %s: difficulty mismatch: have %v, want %v", n, signer, have, want)
+			}
+			if have.ToInt().Cmp(diffInTurn) == 0 {
+				inturn++
+			}
+		}
+		if inturn != 1 {
+			t.Errorf("block %d: in-turn signer count mismatch: have %d, want 1", n, inturn)
+		}
+		// Ensure unauthorized signers are rejected instead of assigned a difficulty
+		number := rpc.BlockNumber(n)
+		if _, err := api.CalcDifficulty(&number, accounts.address("D")); err != errUnauthorizedSigner {
+			t.Errorf("block %d, signer D: error mismatch: have %v, want %v", n, err, errUnauthorizedSigner)
+		}
+	}
+	// Ensure the default and named heights resolve to the right parents
+	head := api.chain.CurrentHeader().Number.Uint64()
+	for _, tt := range []struct {
+		number *rpc.BlockNumber
+		parent uint64
+	}{
+		{nil, head},
+		{ptr(rpc.PendingBlockNumber), head},
+		{ptr(rpc.LatestBlockNumber), head - 1},
+	} {
+		have, err := api.CalcDifficulty(tt.number, accounts.address("A"))
+		if err != nil {
+			t.Fatalf("parent %d: failed to calculate difficulty: %v", tt.parent, err)
+		}
+		api.clique.Authorize(accounts.address("A"))
+		if want := api.clique.CalcDifficulty(api.chain, 0, api.chain.GetHeaderByNumber(tt.parent)); have.ToInt().Cmp(want) != 0 {
+			t.Errorf("parent %d: difficulty mismatch: have %v, want %v", tt.parent, have, want)
+		}
+	}
+	// Ensure heights without a known parent are rejected
+	for _, number := range []rpc.BlockNumber{0, rpc.BlockNumber(head + 2)} {
+		if _, err := api.CalcDifficulty(&number, accounts.address("A")); err != errUnknownBlock {
+			t.Errorf("block %d: error mismatch: have %v, want %v", number, err, errUnknownBlock)
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -24,6 +24,7 @@ import (
 	"io"
 	"math/big"
 	"math/rand"
+	"slices"
 	"sync"
 	"time"
 
@@ -50,6 +51,7 @@ const (
 	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
 	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
 	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	maxReplayBlocks    = 8192 // Number of blocks a historical governance query may replay at most
 )
 
 // Clique proof-of-authority protocol constants.
@@ -396,20 +398,13 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 				break
 			}
 		}
-		// If we're at the genesis, snapshot the initial state. Alternatively if we're
-		// at a checkpoint block without a parent (light client CHT), or we have piled
-		// up more headers than allowed to be reorged (chain reinit from a freezer),
-		// consider the checkpoint trusted and snapshot it.
-		if number == 0 || (number%c.config.Epoch == 0 && (len(headers) > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+		// If we're at the genesis or a trusted checkpoint, snapshot it
+		if c.trustedCheckpoint(chain, number, len(headers)) {
 			checkpoint := chain.GetHeaderByNumber(number)
 			if checkpoint != nil {
 				hash := checkpoint.Hash()
 
-				signers := make([]common.Address, (len(checkpoint.Extra)-extraVanity-extraSeal)/common.AddressLength)
-				for i := 0; i < len(signers); i++ {
-					copy(signers[i][:], checkpoint.Extra[extraVanity+i*common.AddressLength:])
-				}
-				snap = newSnapshot(c.config, c.signatures, number, hash, signers)
+				snap = newSnapshot(c.config, c.signatures, number, hash, checkpointSigners(checkpoint))
 				if err := snap.store(c.db); err != nil {
 					return nil, err
 				}
@@ -456,6 +451,116 @@ func (c *Clique) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	return snap, err
 }
 
+// trustedCheckpoint reports whether the snapshot at the given block can be made
+// straight from its header. This is the case for the genesis and, alternatively,
+// for checkpoint blocks without a parent (light client CHT) or with more pending
+// headers piled up above than allowed to be reorged (chain reinit from a freezer).
+func (c *Clique) trustedCheckpoint(chain consensus.ChainHeaderReader, number uint64, pending int) bool {
+	if number == 0 {
+		return true
+	}
+	return number%c.config.Epoch == 0 && (pending > params.FullImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)
+}
+
+// checkpointSigners extracts the list of signers embedded in the extra-data of a
+// checkpoint header.
+func checkpointSigners(header *types.Header) []common.Address {
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
+}
+
+// verifySnapshot checks a snapshot against the header it was created at, before
+// trusting it as the base of a rebuild or exposing it as the result of one: the
+// tally needs to agree with the votes, and the signers of a checkpoint need to
+// match the list in its extra-data.
+func (c *Clique) verifySnapshot(snap *Snapshot, header *types.Header) error {
+	if snap.Number != header.Number.Uint64() || snap.Hash != header.Hash() {
+		return errInvalidVotingChain
+	}
+	if err := snap.verifyTally(); err != nil {
+		return err
+	}
+	if snap.Number%c.config.Epoch == 0 && !slices.Equal(snap.signers(), checkpointSigners(header)) {
+		return errMismatchingCheckpointSigners
+	}
+	return nil
+}
+
+// rebuildSnapshot regenerates the snapshot at the given block from a trusted
+// base, bypassing any snapshots cached in memory along the way. The base is the
+// genesis, a trusted checkpoint (same as in snapshot) or the nearest on-disk
+// checkpoint other than the block itself that passes verification. The cached
+// and stored entries are only replaced if the regenerated snapshot passes too.
+func (c *Clique) rebuildSnapshot(chain consensus.ChainHeaderReader, number uint64, hash common.Hash) (*Snapshot, error) {
+	// The in-memory copy is suspect regardless of the outcome, drop it
+	c.recents.Remove(hash)
+
+	// Gather the headers back to a trusted base snapshot
+	var (
+		target  *types.Header
+		headers []*types.Header
+		base    *Snapshot
+	)
+	for n, h := number, hash; base == nil; {
+		header := chain.GetHeader(h, n)
+		if header == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+		if target == nil {
+			target = header
+		}
+		if c.trustedCheckpoint(chain, n, len(headers)) {
+			base = newSnapshot(c.config, c.signatures, n, h, checkpointSigners(header))
+			break
+		}
+		if n != number && n%checkpointInterval == 0 {
+			if s, err := loadSnapshot(c.config, c.signatures, c.db, h); err == nil {
+				if err := c.verifySnapshot(s, header); err != nil {
+					log.Warn("Skipping corrupt voting snapshot", "number", n, "hash", h, "err", err)
+				} else {
+					base = s
+					break
+				}
+			}
+		}
+		headers = append(headers, header)
+		n, h = n-1, header.ParentHash
+	}
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	// Regenerate the snapshot and ensure it's sane before exposing it
+	snap, err := base.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.verifySnapshot(snap, target); err != nil {
+		return nil, err
+	}
+	if snap.Number%checkpointInterval == 0 {
+		if err := snap.store(c.db); err != nil {
+			return nil, err
+		}
+	}
+	c.recents.Add(snap.Hash, snap)
+
+	// Evict the skipped intermediate snapshots so they get regenerated from the
+	// trusted base instead of any corrupt copies
+	for _, header := range headers {
+		if header.Hash() != hash {
+			c.recents.Remove(header.Hash())
+		}
+	}
+	if base != snap {
+		c.recents.Add(base.Hash, base)
+	}
+	log.Info("Rebuilt voting snapshot", "number", number, "hash", hash, "base", base.Number)
+	return snap, nil
+}
+
 // VerifyUncles implements consensus.Engine, always returning an error for any
 // uncles as this consensus mechanism doesn't permit uncles.
 func (c *Clique) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
@@ -504,6 +609,123 @@ func (c *Clique) verifySeal(snap *Snapshot, header *types.Header, parents []*typ
 	return nil
 }
 
+// dryRunHeader checks a candidate header against the consensus rules of the
+// engine on top of its parent. Contrary to header verification, it doesn't stop
+// at the first violation, but returns all of them, in the same order as they are
+// checked during verification. If the header is otherwise fine, it is also applied
+// to the parent snapshot to ensure the resulting vote tally stays consistent.
+//
+// The candidate itself is neither cached nor stored, but retrieving its parent
+// snapshot and recovering its signer populate the engine caches as usual.
+func (c *Clique) dryRunHeader(chain consensus.ChainHeaderReader, header *types.Header) ([]error, error) {
+	// Retrieve the parent and its snapshot to check against
+	if header.Number == nil || header.Number.Sign() == 0 {
+		return nil, errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+
+	// Check the standalone header fields
+	if header.Time > uint64(time.Now().Unix()) {
+		errs = append(errs, consensus.ErrFutureBlock)
+	}
+	checkpoint := number%c.config.Epoch == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		errs = append(errs, errInvalidCheckpointBeneficiary)
+	}
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		errs = append(errs, errInvalidVote)
+	} else if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		errs = append(errs, errInvalidCheckpointVote)
+	}
+	sealed := false
+	switch {
+	case len(header.Extra) < extraVanity:
+		errs = append(errs, errMissingVanity)
+	case len(header.Extra) < extraVanity+extraSeal:
+		errs = append(errs, errMissingSignature)
+	default:
+		sealed = true
+	}
+	signersBytes := len(header.Extra) - extraVanity - extraSeal
+	if sealed {
+		if !checkpoint && signersBytes != 0 {
+			errs = append(errs, errExtraSigners)
+		}
+		if checkpoint && signersBytes%common.AddressLength != 0 {
+			errs = append(errs, errInvalidCheckpointSigners)
+		}
+	}
+	if header.MixDigest != (common.Hash{}) {
+		errs = append(errs, errInvalidMixDigest)
+	}
+	if header.UncleHash != uncleHash {
+		errs = append(errs, errInvalidUncleHash)
+	}
+	validDiff := header.Difficulty != nil && (header.Difficulty.Cmp(diffInTurn) == 0 || header.Difficulty.Cmp(diffNoTurn) == 0)
+	if !validDiff {
+		errs = append(errs, errInvalidDifficulty)
+	}
+	// Check the fields depending on the parent and its snapshot
+	if parent.Time+c.config.Period > header.Time {
+		errs = append(errs, errInvalidTimestamp)
+	}
+	if sealed && checkpoint && signersBytes%common.AddressLength == 0 {
+		signers := make([]byte, len(snap.Signers)*common.AddressLength)
+		for i, signer := range snap.signers() {
+			copy(signers[i*common.AddressLength:], signer[:])
+		}
+		if !bytes.Equal(header.Extra[extraVanity:extraVanity+signersBytes], signers) {
+			errs = append(errs, errMismatchingCheckpointSigners)
+		}
+	}
+	// Check the signer's authorization and turn-ness, if it can be recovered
+	if !sealed {
+		return errs, nil
+	}
+	signer, err := ecrecover(header, c.signatures)
+	if err != nil {
+		return append(errs, err), nil
+	}
+	if _, ok := snap.Signers[signer]; !ok {
+		errs = append(errs, errUnauthorizedSigner)
+	}
+	for seen, recent := range snap.Recents {
+		if recent == signer {
+			if limit := uint64(len(snap.Signers)/2 + 1); seen > number-limit {
+				errs = append(errs, errRecentlySigned)
+				break
+			}
+		}
+	}
+	if validDiff && !c.fakeDiff {
+		inturn := snap.inturn(number, signer)
+		if (inturn && header.Difficulty.Cmp(diffInTurn) != 0) || (!inturn && header.Difficulty.Cmp(diffNoTurn) != 0) {
+			errs = append(errs, errWrongDifficulty)
+		}
+	}
+	// If no rule was violated, ensure applying the header keeps the tally sane
+	if len(errs) == 0 {
+		next, err := snap.apply([]*types.Header{header})
+		if err != nil {
+			return []error{err}, nil
+		}
+		if err := next.verifyTally(); err != nil {
+			return []error{err}, nil
+		}
+	}
+	return errs, nil
+}
+
 // Prepare implements consensus.Engine, preparing all the consensus fields of the
 // header for running the transactions on top.
 func (c *Clique) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
@@ -19,6 +19,7 @@ package clique
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"maps"
 	"slices"
 	"time"
@@ -165,6 +166,30 @@ func (s *Snapshot) uncast(address common.Address, authorize bool) bool {
 	return true
 }
 
+// verifyTally checks that the cached vote tally agrees with the chronological
+// list of votes and that every pending vote was cast by an authorized signer.
+func (s *Snapshot) verifyTally() error {
+	tally := make(map[common.Address]Tally)
+	for _, vote := range s.Votes {
+		if _, ok := s.Signers[vote.Signer]; !ok {
+			return fmt.Errorf("vote in block %d cast by unauthorized signer %v", vote.Block, vote.Signer)
+		}
+		if old, ok := tally[vote.Address]; ok && old.Authorize != vote.Authorize {
+			return fmt.Errorf("conflicting votes on %v", vote.Address)
+		}
+		tally[vote.Address] = Tally{Authorize: vote.Authorize, Votes: tally[vote.Address].Votes + 1}
+	}
+	if len(tally) != len(s.Tally) {
+		return fmt.Errorf("tally size mismatch: have %d, want %d", len(s.Tally), len(tally))
+	}
+	for address, want := range tally {
+		if have := s.Tally[address]; have != want {
+			return fmt.Errorf("tally mismatch on %v: have %+v, want %+v", address, have, want)
+		}
+	}
+	return nil
+}
+
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
 func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
@@ -484,6 +484,9 @@ func (tt *cliqueTest) run(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to retrieve voting snapshot: %v", err)
 	}
+	if err := snap.verifyTally(); err != nil {
+		t.Fatalf("inconsistent voting snapshot: %v", err)
+	}
 	// Verify the final list of signers against the expected ones
 	signers = make([]common.Address, len(tt.results))
 	for j, signer := range tt.results {
@@ -45,6 +45,11 @@ web3._extend({
 			call: 'clique_getSnapshotAtHash',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getSnapshotAtTime',
+			call: 'clique_getSnapshotAtTime',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getSigners',
 			call: 'clique_getSigners',
@@ -77,6 +82,53 @@ web3._extend({
 			params: 1,
 			inputFormatter: [null]
 		}),
+		new web3._extend.Method({
+			name: 'calcDifficulty',
+			call: 'clique_calcDifficulty',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputAddressFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'dryRunHeader',
+			call: 'clique_dryRunHeader',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'governanceChangeBlocks',
+			call: 'clique_governanceChangeBlocks',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'rebuildSnapshot',
+			call: 'clique_rebuildSnapshot',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'signerHistory',
+			call: 'clique_signerHistory',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'signerParticipation',
+			call: 'clique_signerParticipation',
+			params: 2,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'signerTimeline',
+			call: 'clique_signerTimeline',
+			params: 3,
+			inputFormatter: [web3._extend.formatters.inputAddressFormatter, web3._extend.formatters.inputBlockNumberFormatter, web3._extend.formatters.inputBlockNumberFormatter]
+		}),
+		new web3._extend.Method({
+			name: 'snapshotStats',
+			call: 'clique_snapshotStats',
+			params: 1,
+			inputFormatter: [web3._extend.formatters.inputBlockNumberFormatter]
+		}),
 	],
 	properties: [
 		new web3._extend.Property({